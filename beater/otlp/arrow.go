@@ -0,0 +1,169 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"io"
+
+	arrowpb "github.com/open-telemetry/otel-arrow/go/pkg/otlp/arrow/v1"
+	"github.com/open-telemetry/otel-arrow/go/pkg/otel/arrow_record"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/collector/consumer"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// maxInFlightArrowStreams bounds the number of concurrent Arrow streams a
+// single gRPC service will decode at once, so that the schema dictionaries
+// cached per stream (see arrow_record.ConsumerAPI) can't grow unboundedly
+// under a connection storm.
+const maxInFlightArrowStreams = 256
+
+var (
+	gRPCArrowRegistry          = monitoring.Default.NewRegistry("apm-server.otlp.grpc.arrow")
+	gRPCArrowBatchCount        = monitoring.NewInt(gRPCArrowRegistry, "batch.count")
+	gRPCArrowRecordCount       = monitoring.NewInt(gRPCArrowRegistry, "record.count")
+	gRPCArrowDecodeErrorCount  = monitoring.NewInt(gRPCArrowRegistry, "decode.errors")
+	gRPCArrowStreamRejectCount = monitoring.NewInt(gRPCArrowRegistry, "stream.rejected")
+)
+
+// registerArrowServices registers the OTel-Arrow trace and metrics streaming
+// services with grpcServer, decoding each BatchArrowRecords message into
+// pdata.Traces/pdata.Metrics and feeding the result through tracesConsumer/
+// metricsConsumer, the same processor chain used by the plain OTLP gRPC
+// services.
+func registerArrowServices(grpcServer *grpc.Server, tracesConsumer consumer.Traces, metricsConsumer consumer.Metrics, logger *logp.Logger) error {
+	streamSem := make(chan struct{}, maxInFlightArrowStreams)
+	arrowpb.RegisterArrowTracesServiceServer(grpcServer, &arrowTracesServer{consumer: tracesConsumer, logger: logger, streamSem: streamSem})
+	arrowpb.RegisterArrowMetricsServiceServer(grpcServer, &arrowMetricsServer{consumer: metricsConsumer, logger: logger, streamSem: streamSem})
+	return nil
+}
+
+type arrowTracesServer struct {
+	arrowpb.UnimplementedArrowTracesServiceServer
+	consumer  consumer.Traces
+	logger    *logp.Logger
+	streamSem chan struct{}
+}
+
+// ArrowTraces implements arrowpb.ArrowTracesServiceServer, consuming a stream
+// of Arrow-encoded trace batches. Each stream gets its own arrow_record
+// consumer so that its dictionary cache is released when the stream ends.
+func (s *arrowTracesServer) ArrowTraces(stream arrowpb.ArrowTracesService_ArrowTracesServer) error {
+	select {
+	case s.streamSem <- struct{}{}:
+		defer func() { <-s.streamSem }()
+	default:
+		gRPCArrowStreamRejectCount.Inc()
+		return errors.New("too many concurrent Arrow streams")
+	}
+
+	decoder := arrow_record.NewConsumer()
+	defer decoder.Close()
+
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		gRPCArrowBatchCount.Inc()
+
+		traces, err := decoder.TracesFrom(batch)
+		if err != nil {
+			gRPCArrowDecodeErrorCount.Inc()
+			s.logger.With(logp.Error(err)).Error("failed to decode Arrow trace batch")
+			if sendErr := stream.Send(&arrowpb.BatchStatus{BatchId: batch.BatchId, StatusCode: arrowpb.StatusInvalidArgument, StatusMessage: err.Error()}); sendErr != nil {
+				return sendErr
+			}
+			continue
+		}
+
+		status := &arrowpb.BatchStatus{BatchId: batch.BatchId, StatusCode: arrowpb.StatusOK}
+		for _, t := range traces {
+			gRPCArrowRecordCount.Add(int64(t.SpanCount()))
+			if err := s.consumer.ConsumeTraces(stream.Context(), t); err != nil {
+				status.StatusCode = arrowpb.StatusInternalError
+				status.StatusMessage = err.Error()
+			}
+		}
+		if err := stream.Send(status); err != nil {
+			return err
+		}
+	}
+}
+
+type arrowMetricsServer struct {
+	arrowpb.UnimplementedArrowMetricsServiceServer
+	consumer  consumer.Metrics
+	logger    *logp.Logger
+	streamSem chan struct{}
+}
+
+// ArrowMetrics implements arrowpb.ArrowMetricsServiceServer, consuming a
+// stream of Arrow-encoded metrics batches. See ArrowTraces for the stream
+// lifecycle and backpressure behaviour, which this mirrors.
+func (s *arrowMetricsServer) ArrowMetrics(stream arrowpb.ArrowMetricsService_ArrowMetricsServer) error {
+	select {
+	case s.streamSem <- struct{}{}:
+		defer func() { <-s.streamSem }()
+	default:
+		gRPCArrowStreamRejectCount.Inc()
+		return errors.New("too many concurrent Arrow streams")
+	}
+
+	decoder := arrow_record.NewConsumer()
+	defer decoder.Close()
+
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		gRPCArrowBatchCount.Inc()
+
+		metrics, err := decoder.MetricsFrom(batch)
+		if err != nil {
+			gRPCArrowDecodeErrorCount.Inc()
+			s.logger.With(logp.Error(err)).Error("failed to decode Arrow metrics batch")
+			if sendErr := stream.Send(&arrowpb.BatchStatus{BatchId: batch.BatchId, StatusCode: arrowpb.StatusInvalidArgument, StatusMessage: err.Error()}); sendErr != nil {
+				return sendErr
+			}
+			continue
+		}
+
+		status := &arrowpb.BatchStatus{BatchId: batch.BatchId, StatusCode: arrowpb.StatusOK}
+		for _, m := range metrics {
+			gRPCArrowRecordCount.Add(int64(m.DataPointCount()))
+			if err := s.consumer.ConsumeMetrics(stream.Context(), m); err != nil {
+				status.StatusCode = arrowpb.StatusInternalError
+				status.StatusMessage = err.Error()
+			}
+		}
+		if err := stream.Send(status); err != nil {
+			return err
+		}
+	}
+}
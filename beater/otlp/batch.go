@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+const (
+	defaultSendBatchSize = 1000
+	defaultBatchTimeout  = time.Second
+)
+
+// traceBatcher accumulates incoming trace batches and forwards them to next
+// once either the configured batch size or timeout is reached.
+type traceBatcher struct {
+	cfg     BatchConfig
+	dropped *monitoring.Int
+	logger  *logp.Logger
+	next    consumer.Traces
+
+	mu      sync.Mutex
+	buf     pdata.Traces
+	spans   int
+	flushAt *time.Timer
+}
+
+func newTraceBatcher(cfg BatchConfig, dropped *monitoring.Int, logger *logp.Logger, next consumer.Traces) *traceBatcher {
+	if cfg.SendBatchSize <= 0 {
+		cfg.SendBatchSize = defaultSendBatchSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultBatchTimeout
+	}
+	return &traceBatcher{cfg: cfg, dropped: dropped, logger: logger, next: next, buf: pdata.NewTraces()}
+}
+
+func (b *traceBatcher) add(ctx context.Context, traces pdata.Traces) error {
+	b.mu.Lock()
+	traces.ResourceSpans().MoveAndAppendTo(b.buf.ResourceSpans())
+	b.spans += traces.SpanCount()
+
+	if b.spans < b.cfg.SendBatchSize {
+		if b.flushAt == nil {
+			// The request ctx that triggered this timer will very likely be
+			// canceled (its handler already returned) by the time the timer
+			// fires, so flushing with it would make the flush fail. Use a
+			// background context instead; errors are reported via flush.
+			b.flushAt = time.AfterFunc(b.cfg.Timeout, func() { b.flush(context.Background()) })
+		}
+		b.mu.Unlock()
+		return nil
+	}
+	out := b.resetLocked()
+	b.mu.Unlock()
+	return b.next.ConsumeTraces(ctx, out)
+}
+
+func (b *traceBatcher) flush(ctx context.Context) {
+	b.mu.Lock()
+	out := b.resetLocked()
+	b.mu.Unlock()
+	if out.SpanCount() == 0 {
+		return
+	}
+	if err := b.next.ConsumeTraces(ctx, out); err != nil {
+		b.dropped.Add(int64(out.SpanCount()))
+		b.logger.With(logp.Error(err)).Error("batch: timer-triggered flush failed, dropping spans")
+	}
+}
+
+func (b *traceBatcher) resetLocked() pdata.Traces {
+	out := b.buf
+	b.buf = pdata.NewTraces()
+	b.spans = 0
+	if b.flushAt != nil {
+		b.flushAt.Stop()
+		b.flushAt = nil
+	}
+	return out
+}
+
+// metricsBatcher is the metrics equivalent of traceBatcher.
+type metricsBatcher struct {
+	cfg     BatchConfig
+	dropped *monitoring.Int
+	logger  *logp.Logger
+	next    consumer.Metrics
+
+	mu         sync.Mutex
+	buf        pdata.Metrics
+	dataPoints int
+	flushAt    *time.Timer
+}
+
+func newMetricsBatcher(cfg BatchConfig, dropped *monitoring.Int, logger *logp.Logger, next consumer.Metrics) *metricsBatcher {
+	if cfg.SendBatchSize <= 0 {
+		cfg.SendBatchSize = defaultSendBatchSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultBatchTimeout
+	}
+	return &metricsBatcher{cfg: cfg, dropped: dropped, logger: logger, next: next, buf: pdata.NewMetrics()}
+}
+
+func (b *metricsBatcher) add(ctx context.Context, metrics pdata.Metrics) error {
+	b.mu.Lock()
+	metrics.ResourceMetrics().MoveAndAppendTo(b.buf.ResourceMetrics())
+	b.dataPoints += metrics.DataPointCount()
+
+	if b.dataPoints < b.cfg.SendBatchSize {
+		if b.flushAt == nil {
+			// See traceBatcher.add: the triggering request's ctx is likely
+			// canceled by the time this timer fires, so flush in the
+			// background and report any error explicitly.
+			b.flushAt = time.AfterFunc(b.cfg.Timeout, func() { b.flush(context.Background()) })
+		}
+		b.mu.Unlock()
+		return nil
+	}
+	out := b.resetLocked()
+	b.mu.Unlock()
+	return b.next.ConsumeMetrics(ctx, out)
+}
+
+func (b *metricsBatcher) flush(ctx context.Context) {
+	b.mu.Lock()
+	out := b.resetLocked()
+	b.mu.Unlock()
+	if out.DataPointCount() == 0 {
+		return
+	}
+	if err := b.next.ConsumeMetrics(ctx, out); err != nil {
+		b.dropped.Add(int64(out.DataPointCount()))
+		b.logger.With(logp.Error(err)).Error("batch: timer-triggered flush failed, dropping data points")
+	}
+}
+
+func (b *metricsBatcher) resetLocked() pdata.Metrics {
+	out := b.buf
+	b.buf = pdata.NewMetrics()
+	b.dataPoints = 0
+	if b.flushAt != nil {
+		b.flushAt.Stop()
+		b.flushAt = nil
+	}
+	return out
+}
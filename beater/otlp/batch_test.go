@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// TestTraceBatcherTimerFlushReportsError verifies that when a timer-triggered
+// flush fails, the loss is counted and logged instead of vanishing silently,
+// and that the flush doesn't use the (by-then-likely-canceled) ctx of the
+// request that started the timer.
+func TestTraceBatcherTimerFlushReportsError(t *testing.T) {
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel() // simulate the originating request having already completed
+
+	dropped := monitoring.NewInt(monitoring.Default.NewRegistry("_test_batch_dropped"), "dropped")
+	next := tracesProcessorFunc(func(ctx context.Context, _ pdata.Traces) error {
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("flush used a canceled context: %v", err)
+		}
+		return errors.New("boom")
+	})
+
+	b := newTraceBatcher(BatchConfig{SendBatchSize: 1000, Timeout: 10 * time.Millisecond}, dropped, logp.NewLogger("otlp_test"), next)
+	traces := pdata.NewTraces()
+	traces.ResourceSpans().AppendEmpty().InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty()
+
+	require := assert.New(t)
+	require.NoError(b.add(reqCtx, traces))
+
+	assert.Eventually(t, func() bool {
+		return dropped.Get() == 1
+	}, time.Second, 5*time.Millisecond, "expected the failed timer flush to be counted as dropped")
+}
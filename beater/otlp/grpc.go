@@ -19,11 +19,11 @@ package otlp
 
 import (
 	"context"
-	"sync"
 
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/collector/consumer/pdata"
 	"go.opentelemetry.io/collector/receiver/otlpreceiver"
+	"go.opentelemetry.io/collector/receiver/otlpreceiver/logs"
 	"go.opentelemetry.io/collector/receiver/otlpreceiver/metrics"
 	"go.opentelemetry.io/collector/receiver/otlpreceiver/trace"
 	"google.golang.org/grpc"
@@ -38,12 +38,14 @@ import (
 var (
 	monitoringKeys = []request.ResultID{
 		request.IDRequestCount, request.IDResponseCount, request.IDResponseErrorsCount, request.IDResponseValidCount,
+		request.IDResponsePartialCount, request.IDResponseRejectedCount,
 	}
 
-	gRPCMetricsRegistry      = monitoring.Default.NewRegistry("apm-server.otlp.grpc.metrics")
-	gRPCMetricsMonitoringMap = request.MonitoringMapForRegistry(gRPCMetricsRegistry, monitoringKeys)
-	gRPCTracesRegistry       = monitoring.Default.NewRegistry("apm-server.otlp.grpc.traces")
-	gRPCTracesMonitoringMap  = request.MonitoringMapForRegistry(gRPCTracesRegistry, monitoringKeys)
+	gRPCMetricsRegistry = monitoring.Default.NewRegistry("apm-server.otlp.grpc.metrics")
+	gRPCTracesRegistry  = monitoring.Default.NewRegistry("apm-server.otlp.grpc.traces")
+	gRPCLogsRegistry    = monitoring.Default.NewRegistry("apm-server.otlp.grpc.logs")
+
+	gRPCConsumers = newConsumerSet()
 )
 
 func init() {
@@ -51,85 +53,158 @@ func init() {
 }
 
 // RegisterGRPCServices registers OTLP consumer services with the given gRPC server.
-func RegisterGRPCServices(grpcServer *grpc.Server, processor model.BatchProcessor, logger *logp.Logger) error {
+// endpoint identifies the listener the services are exposed on (e.g. its bind
+// address), and is used to label this listener's metrics so that operators
+// running multiple OTLP gRPC listeners can distinguish their traffic.
+// procsCfg configures the chain of processors applied to traces and metrics
+// before they reach the ingest pipeline.
+func RegisterGRPCServices(grpcServer *grpc.Server, endpoint string, procsCfg ProcessorsConfig, processor model.BatchProcessor, logger *logp.Logger) error {
+	if gRPCConsumers.has(endpoint) {
+		return errors.Errorf("OTLP gRPC services already registered for endpoint %q", endpoint)
+	}
 	consumer := &monitoredConsumer{
-		consumer: &otel.Consumer{Processor: processor},
-		logger:   logger,
+		consumer:   &otel.Consumer{Processor: processor},
+		logger:     logger,
+		tracesMap:  request.MonitoringMapForRegistry(gRPCTracesRegistry.NewRegistry(endpoint), monitoringKeys),
+		metricsMap: request.MonitoringMapForRegistry(gRPCMetricsRegistry.NewRegistry(endpoint), monitoringKeys),
+		logsMap:    request.MonitoringMapForRegistry(gRPCLogsRegistry.NewRegistry(endpoint), monitoringKeys),
 	}
+	gRPCConsumers.add(endpoint, consumer)
 
-	// TODO(axw) stop assuming we have only one OTLP gRPC service running
-	// at any time, and instead aggregate metrics from consumers that are
-	// dynamically registered and unregistered.
-	setCurrentMonitoredConsumer(consumer)
+	tracesConsumer, err := newTracesChain(endpoint, procsCfg, logger, consumer)
+	if err != nil {
+		gRPCConsumers.remove(endpoint)
+		return errors.Wrap(err, "failed to build OTLP traces processor chain")
+	}
+	metricsConsumer, err := newMetricsChain(endpoint, procsCfg, logger, consumer)
+	if err != nil {
+		gRPCConsumers.remove(endpoint)
+		return errors.Wrap(err, "failed to build OTLP metrics processor chain")
+	}
 
-	traceReceiver := trace.New("otlp", consumer)
-	metricsReceiver := metrics.New("otlp", consumer)
+	traceReceiver := trace.New("otlp", tracesConsumer)
+	metricsReceiver := metrics.New("otlp", metricsConsumer)
+	logsReceiver := logs.New("otlp", consumer)
 	if err := otlpreceiver.RegisterTraceReceiver(context.Background(), traceReceiver, grpcServer, nil); err != nil {
+		gRPCConsumers.remove(endpoint)
 		return errors.Wrap(err, "failed to register OTLP trace receiver")
 	}
 	if err := otlpreceiver.RegisterMetricsReceiver(context.Background(), metricsReceiver, grpcServer, nil); err != nil {
+		gRPCConsumers.remove(endpoint)
 		return errors.Wrap(err, "failed to register OTLP metrics receiver")
 	}
+	if err := otlpreceiver.RegisterLogsReceiver(context.Background(), logsReceiver, grpcServer, nil); err != nil {
+		gRPCConsumers.remove(endpoint)
+		return errors.Wrap(err, "failed to register OTLP logs receiver")
+	}
+	if err := registerArrowServices(grpcServer, tracesConsumer, metricsConsumer, logger); err != nil {
+		gRPCConsumers.remove(endpoint)
+		return errors.Wrap(err, "failed to register OTel-Arrow services")
+	}
 	return nil
 }
 
+// monitoredConsumer wraps an otel.Consumer, recording request/response/error
+// counts for the data it consumes in the given monitoring maps. The maps are
+// supplied by the caller so the same wrapper can be reused across transports
+// (e.g. gRPC and HTTP) that each expose their own monitoring registry.
 type monitoredConsumer struct {
-	consumer *otel.Consumer
-	logger   *logp.Logger
+	consumer   *otel.Consumer
+	logger     *logp.Logger
+	tracesMap  map[request.ResultID]*monitoring.Int
+	metricsMap map[request.ResultID]*monitoring.Int
+	logsMap    map[request.ResultID]*monitoring.Int
 }
 
-// ConsumeTraces consumes OpenTelemtry trace data.
+// ConsumeTraces implements consumer.Traces, consuming OpenTelemetry trace data.
 func (c *monitoredConsumer) ConsumeTraces(ctx context.Context, traces pdata.Traces) error {
-	gRPCTracesMonitoringMap[request.IDRequestCount].Inc()
-	defer gRPCTracesMonitoringMap[request.IDResponseCount].Inc()
-	if err := c.consumer.ConsumeTraces(ctx, traces); err != nil {
-		gRPCTracesMonitoringMap[request.IDResponseErrorsCount].Inc()
+	_, err := c.consumeTraces(ctx, traces)
+	return err
+}
+
+// consumeTraces consumes OpenTelemetry trace data, returning the structured
+// result so that partial-success details can be reported back to callers
+// that control their own response encoding (e.g. OTLP/HTTP).
+func (c *monitoredConsumer) consumeTraces(ctx context.Context, traces pdata.Traces) (otel.ConsumeResult, error) {
+	c.tracesMap[request.IDRequestCount].Inc()
+	defer c.tracesMap[request.IDResponseCount].Inc()
+	result, err := c.consumer.ConsumeTraces(ctx, traces)
+	if result.Rejected > 0 {
+		c.tracesMap[request.IDResponsePartialCount].Inc()
+		c.tracesMap[request.IDResponseRejectedCount].Add(int64(result.Rejected))
+	}
+	if err != nil {
+		c.tracesMap[request.IDResponseErrorsCount].Inc()
 		c.logger.With(logp.Error(err)).Error("ConsumeTraces returned an error")
-		return err
+		return result, err
 	}
-	gRPCTracesMonitoringMap[request.IDResponseValidCount].Inc()
-	return nil
+	c.tracesMap[request.IDResponseValidCount].Inc()
+	return result, nil
 }
 
-// ConsumeMetrics consumes OpenTelemtry metrics data.
+// ConsumeMetrics implements consumer.Metrics, consuming OpenTelemetry metrics data.
 func (c *monitoredConsumer) ConsumeMetrics(ctx context.Context, metrics pdata.Metrics) error {
-	gRPCMetricsMonitoringMap[request.IDRequestCount].Inc()
-	defer gRPCMetricsMonitoringMap[request.IDResponseCount].Inc()
-	if err := c.consumer.ConsumeMetrics(ctx, metrics); err != nil {
-		gRPCMetricsMonitoringMap[request.IDResponseErrorsCount].Inc()
+	_, err := c.consumeMetrics(ctx, metrics)
+	return err
+}
+
+// consumeMetrics consumes OpenTelemetry metrics data, returning the structured
+// result so that partial-success details can be reported back to callers
+// that control their own response encoding (e.g. OTLP/HTTP).
+func (c *monitoredConsumer) consumeMetrics(ctx context.Context, metrics pdata.Metrics) (otel.ConsumeResult, error) {
+	c.metricsMap[request.IDRequestCount].Inc()
+	defer c.metricsMap[request.IDResponseCount].Inc()
+	result, err := c.consumer.ConsumeMetrics(ctx, metrics)
+	if result.Rejected > 0 {
+		c.metricsMap[request.IDResponsePartialCount].Inc()
+		c.metricsMap[request.IDResponseRejectedCount].Add(int64(result.Rejected))
+	}
+	if err != nil {
+		c.metricsMap[request.IDResponseErrorsCount].Inc()
 		c.logger.With(logp.Error(err)).Error("ConsumeMetrics returned an error")
-		return err
+		return result, err
 	}
-	gRPCMetricsMonitoringMap[request.IDResponseValidCount].Inc()
-	return nil
+	c.metricsMap[request.IDResponseValidCount].Inc()
+	return result, nil
 }
 
-func (c *monitoredConsumer) collectMetricsMonitoring(_ monitoring.Mode, V monitoring.Visitor) {
-	V.OnRegistryStart()
-	V.OnRegistryFinished()
-
-	stats := c.consumer.Stats()
-	monitoring.ReportNamespace(V, "consumer", func() {
-		monitoring.ReportInt(V, "unsupported_dropped", stats.UnsupportedMetricsDropped)
-	})
+// ConsumeLogs implements consumer.Logs, consuming OpenTelemetry log records.
+func (c *monitoredConsumer) ConsumeLogs(ctx context.Context, logs pdata.Logs) error {
+	_, err := c.consumeLogs(ctx, logs)
+	return err
 }
 
-var (
-	currentMonitoredConsumerMu sync.RWMutex
-	currentMonitoredConsumer   *monitoredConsumer
-)
-
-func setCurrentMonitoredConsumer(c *monitoredConsumer) {
-	currentMonitoredConsumerMu.Lock()
-	defer currentMonitoredConsumerMu.Unlock()
-	currentMonitoredConsumer = c
+// consumeLogs consumes OpenTelemetry log records, returning the structured
+// result so that partial-success details can be reported back to callers
+// that control their own response encoding (e.g. OTLP/HTTP).
+func (c *monitoredConsumer) consumeLogs(ctx context.Context, logs pdata.Logs) (otel.ConsumeResult, error) {
+	c.logsMap[request.IDRequestCount].Inc()
+	defer c.logsMap[request.IDResponseCount].Inc()
+	result, err := c.consumer.ConsumeLogs(ctx, logs)
+	if result.Rejected > 0 {
+		c.logsMap[request.IDResponsePartialCount].Inc()
+		c.logsMap[request.IDResponseRejectedCount].Add(int64(result.Rejected))
+	}
+	if err != nil {
+		c.logsMap[request.IDResponseErrorsCount].Inc()
+		c.logger.With(logp.Error(err)).Error("ConsumeLogs returned an error")
+		return result, err
+	}
+	c.logsMap[request.IDResponseValidCount].Inc()
+	return result, nil
 }
 
-func collectMetricsMonitoring(mode monitoring.Mode, V monitoring.Visitor) {
-	currentMonitoredConsumerMu.RLock()
-	c := currentMonitoredConsumer
-	currentMonitoredConsumerMu.RUnlock()
-	if c != nil {
-		c.collectMetricsMonitoring(mode, V)
+// collectMetricsMonitoring sums the consumer stats (e.g. UnsupportedMetricsDropped)
+// across every endpoint currently registered in gRPCConsumers.
+func collectMetricsMonitoring(_ monitoring.Mode, V monitoring.Visitor) {
+	V.OnRegistryStart()
+	defer V.OnRegistryFinished()
+
+	var unsupportedDropped int64
+	for _, c := range gRPCConsumers.snapshot() {
+		unsupportedDropped += c.consumer.Stats().UnsupportedMetricsDropped
 	}
+	monitoring.ReportNamespace(V, "consumer", func() {
+		monitoring.ReportInt(V, "unsupported_dropped", unsupportedDropped)
+	})
 }
@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/model/otlpgrpc"
+
+	"github.com/elastic/apm-server/beater/request"
+	"github.com/elastic/apm-server/model"
+	"github.com/elastic/apm-server/processor/otel"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+var (
+	httpTracesRegistry  = monitoring.Default.NewRegistry("apm-server.otlp.http.traces")
+	httpMetricsRegistry = monitoring.Default.NewRegistry("apm-server.otlp.http.metrics")
+
+	httpConsumers = newConsumerSet()
+
+	tracesUnmarshaler  = otlp.NewProtobufTracesUnmarshaler()
+	metricsUnmarshaler = otlp.NewProtobufMetricsUnmarshaler()
+)
+
+func init() {
+	monitoring.NewFunc(httpMetricsRegistry, "consumer", collectHTTPMetricsMonitoring, monitoring.Report)
+}
+
+// RegisterHTTPHandlers registers OTLP/HTTP handlers for traces and metrics on mux,
+// mirroring the gRPC services registered by RegisterGRPCServices. endpoint
+// identifies this listener and is used to label its metrics.
+// procsCfg configures the chain of processors applied to traces and metrics
+// before they reach the ingest pipeline.
+func RegisterHTTPHandlers(mux *http.ServeMux, endpoint string, procsCfg ProcessorsConfig, processor model.BatchProcessor, logger *logp.Logger) error {
+	if httpConsumers.has(endpoint) {
+		return errors.Errorf("OTLP HTTP handlers already registered for endpoint %q", endpoint)
+	}
+	mc := &monitoredConsumer{
+		consumer:   &otel.Consumer{Processor: processor},
+		logger:     logger,
+		tracesMap:  request.MonitoringMapForRegistry(httpTracesRegistry.NewRegistry(endpoint), monitoringKeys),
+		metricsMap: request.MonitoringMapForRegistry(httpMetricsRegistry.NewRegistry(endpoint), monitoringKeys),
+	}
+	httpConsumers.add(endpoint, mc)
+
+	tracesConsumer, err := newTracesChain(endpoint, procsCfg, logger, mc)
+	if err != nil {
+		httpConsumers.remove(endpoint)
+		return errors.Wrap(err, "failed to build OTLP traces processor chain")
+	}
+	metricsConsumer, err := newMetricsChain(endpoint, procsCfg, logger, mc)
+	if err != nil {
+		httpConsumers.remove(endpoint)
+		return errors.Wrap(err, "failed to build OTLP metrics processor chain")
+	}
+
+	mux.HandleFunc("/v1/traces", handleOTLPHTTPTraces(tracesConsumer))
+	mux.HandleFunc("/v1/metrics", handleOTLPHTTPMetrics(metricsConsumer))
+	return nil
+}
+
+// handleOTLPHTTPTraces decodes an ExportTraceServiceRequest protobuf body and
+// feeds it through tracesConsumer, the head of the same processor chain used
+// for gRPC. When no processors are configured, tracesConsumer is the
+// monitoredConsumer itself and partial-success details are reported back to
+// the caller; otherwise the chain only reports success or failure.
+func handleOTLPHTTPTraces(tracesConsumer consumer.Traces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		traces, err := tracesUnmarshaler.UnmarshalTraces(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := otlpgrpc.NewTracesResponse()
+		if mc, ok := tracesConsumer.(*monitoredConsumer); ok {
+			result, err := mc.consumeTraces(r.Context(), traces)
+			if result.Rejected > 0 {
+				resp.PartialSuccess().SetRejectedSpans(int64(result.Rejected))
+				resp.PartialSuccess().SetErrorMessage(result.ErrorMessage)
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if err := tracesConsumer.ConsumeTraces(r.Context(), traces); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeOTLPHTTPResponse(w, resp)
+	}
+}
+
+// handleOTLPHTTPMetrics decodes an ExportMetricsServiceRequest protobuf body and
+// feeds it through metricsConsumer, the head of the same processor chain used
+// for gRPC. See handleOTLPHTTPTraces for how partial success is reported.
+func handleOTLPHTTPMetrics(metricsConsumer consumer.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metrics, err := metricsUnmarshaler.UnmarshalMetrics(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := otlpgrpc.NewMetricsResponse()
+		if mc, ok := metricsConsumer.(*monitoredConsumer); ok {
+			result, err := mc.consumeMetrics(r.Context(), metrics)
+			if result.Rejected > 0 {
+				resp.PartialSuccess().SetRejectedDataPoints(int64(result.Rejected))
+				resp.PartialSuccess().SetErrorMessage(result.ErrorMessage)
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if err := metricsConsumer.ConsumeMetrics(r.Context(), metrics); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeOTLPHTTPResponse(w, resp)
+	}
+}
+
+// otlpResponse is implemented by the generated OTLP export response types,
+// each of which marshals to the OTLP/HTTP protobuf wire format.
+type otlpResponse interface {
+	Marshal() ([]byte, error)
+}
+
+func writeOTLPHTTPResponse(w http.ResponseWriter, resp otlpResponse) {
+	body, err := resp.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// collectHTTPMetricsMonitoring sums the consumer stats across every endpoint
+// currently registered in httpConsumers.
+func collectHTTPMetricsMonitoring(_ monitoring.Mode, V monitoring.Visitor) {
+	V.OnRegistryStart()
+	defer V.OnRegistryFinished()
+
+	var unsupportedDropped int64
+	for _, c := range httpConsumers.snapshot() {
+		unsupportedDropped += c.consumer.Stats().UnsupportedMetricsDropped
+	}
+	monitoring.ReportNamespace(V, "consumer", func() {
+		monitoring.ReportInt(V, "unsupported_dropped", unsupportedDropped)
+	})
+}
@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/model/otlpgrpc"
+
+	"github.com/elastic/apm-server/beater/request"
+	"github.com/elastic/apm-server/model"
+	otelprocessor "github.com/elastic/apm-server/processor/otel"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// rejectingBatchProcessor rejects every batch handed to it, the way a real
+// model.BatchProcessor would if ingestion fails downstream.
+type rejectingBatchProcessor struct{}
+
+func (rejectingBatchProcessor) ProcessBatch(context.Context, *model.Batch) error {
+	return errors.New("ingest failed")
+}
+
+func newTestMonitoredConsumer(t *testing.T, name string) *monitoredConsumer {
+	t.Helper()
+	return &monitoredConsumer{
+		consumer:   &otelprocessor.Consumer{Processor: rejectingBatchProcessor{}},
+		logger:     logp.NewLogger("otlp_test"),
+		tracesMap:  request.MonitoringMapForRegistry(monitoring.Default.NewRegistry(name+"_traces"), monitoringKeys),
+		metricsMap: request.MonitoringMapForRegistry(monitoring.Default.NewRegistry(name+"_metrics"), monitoringKeys),
+	}
+}
+
+// TestHandleOTLPHTTPTracesPartialSuccess verifies that a rejected batch is
+// reported back to the caller as an OTLP partial-success response, rather
+// than just failing the whole request.
+func TestHandleOTLPHTTPTracesPartialSuccess(t *testing.T) {
+	traces := pdata.NewTraces()
+	traces.ResourceSpans().AppendEmpty().InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty()
+	body, err := otlp.NewProtobufTracesMarshaler().MarshalTraces(traces)
+	require.NoError(t, err)
+
+	mc := newTestMonitoredConsumer(t, "_test_http_traces_partial")
+	handler := handleOTLPHTTPTraces(mc)
+
+	req := httptest.NewRequest("POST", "/v1/traces", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	require.Equal(t, 200, rec.Code)
+	resp := otlpgrpc.NewTracesResponse()
+	require.NoError(t, resp.Unmarshal(rec.Body.Bytes()))
+	assert.Equal(t, int64(1), resp.PartialSuccess().RejectedSpans())
+	assert.Equal(t, "ingest failed", resp.PartialSuccess().ErrorMessage())
+}
+
+// TestHandleOTLPHTTPMetricsPartialSuccess mirrors
+// TestHandleOTLPHTTPTracesPartialSuccess for the metrics handler.
+func TestHandleOTLPHTTPMetricsPartialSuccess(t *testing.T) {
+	metrics := pdata.NewMetrics()
+	metric := metrics.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("queue.size")
+	metric.SetDataType(pdata.MetricDataTypeGauge)
+	metric.Gauge().DataPoints().AppendEmpty().SetDoubleVal(1)
+	body, err := otlp.NewProtobufMetricsMarshaler().MarshalMetrics(metrics)
+	require.NoError(t, err)
+
+	mc := newTestMonitoredConsumer(t, "_test_http_metrics_partial")
+	handler := handleOTLPHTTPMetrics(mc)
+
+	req := httptest.NewRequest("POST", "/v1/metrics", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	require.Equal(t, 200, rec.Code)
+	resp := otlpgrpc.NewMetricsResponse()
+	require.NoError(t, resp.Unmarshal(rec.Body.Bytes()))
+	assert.Equal(t, int64(1), resp.PartialSuccess().RejectedDataPoints())
+	assert.Equal(t, "ingest failed", resp.PartialSuccess().ErrorMessage())
+}
+
+// TestHandleOTLPHTTPTracesInvalidBody verifies that a body that doesn't
+// decode as an ExportTraceServiceRequest is rejected with 400, without
+// reaching the consumer.
+func TestHandleOTLPHTTPTracesInvalidBody(t *testing.T) {
+	mc := newTestMonitoredConsumer(t, "_test_http_traces_invalid")
+	handler := handleOTLPHTTPTraces(mc)
+
+	req := httptest.NewRequest("POST", "/v1/traces", bytes.NewReader([]byte("not a valid protobuf body")))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, 400, rec.Code)
+}
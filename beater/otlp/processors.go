@@ -0,0 +1,341 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// ProcessorsConfig configures the chain of processors applied to OTLP data
+// between receipt and handoff to the Elastic ingest pipeline, mirroring the
+// OpenTelemetry Collector's processor concept without requiring operators to
+// run a separate Collector process in front of apm-server.
+//
+// Processors lists the configured chain by id, e.g.
+// "apm-server.otlp.processors: [batch, memory_limiter, attributes/drop_pii,
+// probabilistic_sampler]". An "attributes/<name>" id looks up its rules in
+// Attributes under <name>; the other processor types each use their single
+// config below, and any "/name" suffix on their ids is ignored.
+type ProcessorsConfig struct {
+	Processors           []string                    `config:"processors"`
+	Batch                BatchConfig                 `config:"batch"`
+	MemoryLimiter        MemoryLimiterConfig         `config:"memory_limiter"`
+	Attributes           map[string]AttributesConfig `config:"attributes"`
+	ProbabilisticSampler ProbabilisticSamplerConfig  `config:"probabilistic_sampler"`
+}
+
+// BatchConfig configures the batch processor.
+type BatchConfig struct {
+	SendBatchSize int           `config:"send_batch_size"`
+	Timeout       time.Duration `config:"timeout"`
+}
+
+// MemoryLimiterConfig configures the memory_limiter processor.
+type MemoryLimiterConfig struct {
+	LimitBytes uint64 `config:"limit_bytes"`
+}
+
+// AttributesConfig configures a named attributes processor, identified in
+// ProcessorsConfig.Processors as "attributes/<name>".
+type AttributesConfig struct {
+	Drop   []string          `config:"drop"`
+	Rename map[string]string `config:"rename"`
+}
+
+// ProbabilisticSamplerConfig configures the probabilistic_sampler processor.
+type ProbabilisticSamplerConfig struct {
+	SamplingPercentage float64 `config:"sampling_percentage"`
+}
+
+var (
+	otlpProcessorsRegistry = monitoring.Default.NewRegistry("apm-server.otlp.processors")
+
+	stageDroppedCountersMu sync.Mutex
+	stageDroppedCounters   = make(map[string]*monitoring.Int)
+	stageDroppedRegistries = make(map[string]*monitoring.Registry)
+)
+
+// stageDroppedCounter returns the monitoring counter tracking drops for the
+// processor chain stage identified by id on the listener bound to endpoint,
+// creating it on first use. The result is cached per (endpoint, id): without
+// endpoint in the key, two listeners configuring the same processor id (e.g.
+// both "apm-server.otlp.processors: [batch]") would share one dropped
+// counter, undercutting the per-endpoint metrics chunk0-4 established
+// elsewhere. It's also cached because newTracesChain and newMetricsChain both
+// build a chain from the same cfg.Processors list and would otherwise each
+// try to register a sub-registry named id, and monitoring.Registry.NewRegistry
+// panics on a duplicate name.
+func stageDroppedCounter(endpoint, id string) *monitoring.Int {
+	stageDroppedCountersMu.Lock()
+	defer stageDroppedCountersMu.Unlock()
+	key := endpoint + "/" + id
+	if counter, ok := stageDroppedCounters[key]; ok {
+		return counter
+	}
+	endpointRegistry, ok := stageDroppedRegistries[endpoint]
+	if !ok {
+		endpointRegistry = otlpProcessorsRegistry.NewRegistry(endpoint)
+		stageDroppedRegistries[endpoint] = endpointRegistry
+	}
+	counter := monitoring.NewInt(endpointRegistry.NewRegistry(id), "dropped")
+	stageDroppedCounters[key] = counter
+	return counter
+}
+
+// newTracesChain builds the ordered chain of trace processors described by
+// cfg.Processors, terminating in next. endpoint identifies the listener this
+// chain belongs to, and scopes each stage's dropped counter to that listener.
+// logger is used to report errors from stages that have no synchronous
+// caller to propagate them to, such as the batch processor's timer-triggered
+// flush.
+func newTracesChain(endpoint string, cfg ProcessorsConfig, logger *logp.Logger, next consumer.Traces) (consumer.Traces, error) {
+	chain := next
+	for i := len(cfg.Processors) - 1; i >= 0; i-- {
+		id := cfg.Processors[i]
+		typ, name := splitComponentID(id)
+		dropped := stageDroppedCounter(endpoint, id)
+		switch typ {
+		case "batch":
+			chain = newBatchTracesProcessor(cfg.Batch, dropped, logger, chain)
+		case "memory_limiter":
+			chain = newMemoryLimiterTracesProcessor(cfg.MemoryLimiter, dropped, chain)
+		case "attributes":
+			rules, ok := cfg.Attributes[name]
+			if !ok {
+				return nil, errors.Errorf("no attributes config found for processor %q", id)
+			}
+			chain = newAttributesTracesProcessor(rules, chain)
+		case "probabilistic_sampler":
+			samplerChain, err := newProbabilisticSamplerTracesProcessor(cfg.ProbabilisticSampler, dropped, chain)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid OTLP processor %q", id)
+			}
+			chain = samplerChain
+		default:
+			return nil, errors.Errorf("unknown OTLP processor %q", id)
+		}
+	}
+	return chain, nil
+}
+
+// newMetricsChain builds the ordered chain of metrics processors described by
+// cfg.Processors, terminating in next. endpoint identifies the listener this
+// chain belongs to, and scopes each stage's dropped counter to that listener.
+// probabilistic_sampler has no effect on metrics and is accepted as a no-op
+// so the same chain config can be shared between traces and metrics. logger
+// is used to report errors from stages that have no synchronous caller to
+// propagate them to, such as the batch processor's timer-triggered flush.
+func newMetricsChain(endpoint string, cfg ProcessorsConfig, logger *logp.Logger, next consumer.Metrics) (consumer.Metrics, error) {
+	chain := next
+	for i := len(cfg.Processors) - 1; i >= 0; i-- {
+		id := cfg.Processors[i]
+		typ, name := splitComponentID(id)
+		dropped := stageDroppedCounter(endpoint, id)
+		switch typ {
+		case "batch":
+			chain = newBatchMetricsProcessor(cfg.Batch, dropped, logger, chain)
+		case "memory_limiter":
+			chain = newMemoryLimiterMetricsProcessor(cfg.MemoryLimiter, dropped, chain)
+		case "attributes":
+			rules, ok := cfg.Attributes[name]
+			if !ok {
+				return nil, errors.Errorf("no attributes config found for processor %q", id)
+			}
+			chain = newAttributesMetricsProcessor(rules, chain)
+		case "probabilistic_sampler":
+			// No-op for metrics: sampling only applies to traces.
+		default:
+			return nil, errors.Errorf("unknown OTLP processor %q", id)
+		}
+	}
+	return chain, nil
+}
+
+// splitComponentID splits a Collector-style "type/name" processor id into its
+// type and optional name, e.g. "attributes/drop_pii" -> ("attributes", "drop_pii").
+func splitComponentID(id string) (typ, name string) {
+	if i := strings.IndexByte(id, '/'); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+	return id, ""
+}
+
+// tracesProcessorFunc adapts a function to consumer.Traces.
+type tracesProcessorFunc func(ctx context.Context, traces pdata.Traces) error
+
+func (f tracesProcessorFunc) ConsumeTraces(ctx context.Context, traces pdata.Traces) error {
+	return f(ctx, traces)
+}
+
+// metricsProcessorFunc adapts a function to consumer.Metrics.
+type metricsProcessorFunc func(ctx context.Context, metrics pdata.Metrics) error
+
+func (f metricsProcessorFunc) ConsumeMetrics(ctx context.Context, metrics pdata.Metrics) error {
+	return f(ctx, metrics)
+}
+
+// newBatchTracesProcessor returns a processor that buffers trace batches
+// until either cfg.SendBatchSize spans have accumulated or cfg.Timeout has
+// elapsed, then forwards the combined batch to next. dropped counts spans
+// lost when a timer-triggered flush fails, and logger reports the error
+// causing the loss.
+func newBatchTracesProcessor(cfg BatchConfig, dropped *monitoring.Int, logger *logp.Logger, next consumer.Traces) consumer.Traces {
+	b := newTraceBatcher(cfg, dropped, logger, next)
+	return tracesProcessorFunc(b.add)
+}
+
+// newBatchMetricsProcessor returns a processor that buffers metrics batches
+// until either cfg.SendBatchSize data points have accumulated or cfg.Timeout
+// has elapsed, then forwards the combined batch to next. dropped counts data
+// points lost when a timer-triggered flush fails, and logger reports the
+// error causing the loss.
+func newBatchMetricsProcessor(cfg BatchConfig, dropped *monitoring.Int, logger *logp.Logger, next consumer.Metrics) consumer.Metrics {
+	b := newMetricsBatcher(cfg, dropped, logger, next)
+	return metricsProcessorFunc(b.add)
+}
+
+// newMemoryLimiterTracesProcessor returns a processor that rejects trace
+// batches while the process is above cfg.LimitBytes of allocated memory, to
+// provide backpressure instead of risking an OOM under load.
+func newMemoryLimiterTracesProcessor(cfg MemoryLimiterConfig, dropped *monitoring.Int, next consumer.Traces) consumer.Traces {
+	return tracesProcessorFunc(func(ctx context.Context, traces pdata.Traces) error {
+		if aboveMemoryLimit(cfg) {
+			dropped.Inc()
+			return errors.New("memory_limiter: rejecting batch, memory limit exceeded")
+		}
+		return next.ConsumeTraces(ctx, traces)
+	})
+}
+
+// newMemoryLimiterMetricsProcessor is the metrics equivalent of
+// newMemoryLimiterTracesProcessor.
+func newMemoryLimiterMetricsProcessor(cfg MemoryLimiterConfig, dropped *monitoring.Int, next consumer.Metrics) consumer.Metrics {
+	return metricsProcessorFunc(func(ctx context.Context, metrics pdata.Metrics) error {
+		if aboveMemoryLimit(cfg) {
+			dropped.Inc()
+			return errors.New("memory_limiter: rejecting batch, memory limit exceeded")
+		}
+		return next.ConsumeMetrics(ctx, metrics)
+	})
+}
+
+func aboveMemoryLimit(cfg MemoryLimiterConfig) bool {
+	if cfg.LimitBytes == 0 {
+		return false
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return mem.Alloc > cfg.LimitBytes
+}
+
+// newAttributesTracesProcessor returns a processor that drops and renames
+// resource and span attributes according to rules.
+func newAttributesTracesProcessor(rules AttributesConfig, next consumer.Traces) consumer.Traces {
+	return tracesProcessorFunc(func(ctx context.Context, traces pdata.Traces) error {
+		rs := traces.ResourceSpans()
+		for i := 0; i < rs.Len(); i++ {
+			resourceSpans := rs.At(i)
+			applyAttributeRules(rules, resourceSpans.Resource().Attributes())
+			ilss := resourceSpans.InstrumentationLibrarySpans()
+			for j := 0; j < ilss.Len(); j++ {
+				spans := ilss.At(j).Spans()
+				for k := 0; k < spans.Len(); k++ {
+					applyAttributeRules(rules, spans.At(k).Attributes())
+				}
+			}
+		}
+		return next.ConsumeTraces(ctx, traces)
+	})
+}
+
+// newAttributesMetricsProcessor is the metrics equivalent of
+// newAttributesTracesProcessor, applied to resource attributes only.
+func newAttributesMetricsProcessor(rules AttributesConfig, next consumer.Metrics) consumer.Metrics {
+	return metricsProcessorFunc(func(ctx context.Context, metrics pdata.Metrics) error {
+		rm := metrics.ResourceMetrics()
+		for i := 0; i < rm.Len(); i++ {
+			applyAttributeRules(rules, rm.At(i).Resource().Attributes())
+		}
+		return next.ConsumeMetrics(ctx, metrics)
+	})
+}
+
+func applyAttributeRules(rules AttributesConfig, attrs pdata.AttributeMap) {
+	for _, key := range rules.Drop {
+		attrs.Delete(key)
+	}
+	for from, to := range rules.Rename {
+		if v, ok := attrs.Get(from); ok {
+			attrs.Upsert(to, v)
+			attrs.Delete(from)
+		}
+	}
+}
+
+// newProbabilisticSamplerTracesProcessor returns a processor implementing
+// head-based probabilistic sampling: each trace is kept or dropped in its
+// entirety based on a hash of its trace ID, so that all spans of a sampled
+// trace are kept consistently across batches. cfg.SamplingPercentage must be
+// in (0, 100]; a zero value (e.g. an operator forgetting to set it) would
+// otherwise silently sample almost nothing, so it's rejected here rather than
+// defaulted.
+func newProbabilisticSamplerTracesProcessor(cfg ProbabilisticSamplerConfig, dropped *monitoring.Int, next consumer.Traces) (consumer.Traces, error) {
+	if cfg.SamplingPercentage <= 0 || cfg.SamplingPercentage > 100 {
+		return nil, errors.Errorf("sampling_percentage must be in (0, 100], got %v", cfg.SamplingPercentage)
+	}
+	threshold := uint32(cfg.SamplingPercentage / 100 * float64(^uint32(0)))
+	return tracesProcessorFunc(func(ctx context.Context, traces pdata.Traces) error {
+		rs := traces.ResourceSpans()
+		for i := 0; i < rs.Len(); i++ {
+			ilss := rs.At(i).InstrumentationLibrarySpans()
+			for j := 0; j < ilss.Len(); j++ {
+				spans := ilss.At(j).Spans()
+				kept := 0
+				for k := 0; k < spans.Len(); k++ {
+					span := spans.At(k)
+					if sampleTraceID(span.TraceID().Bytes()) <= threshold {
+						span.CopyTo(spans.At(kept)) // no-op when kept == k
+						kept++
+					} else {
+						dropped.Inc()
+					}
+				}
+				spans.Resize(kept)
+			}
+		}
+		return next.ConsumeTraces(ctx, traces)
+	}), nil
+}
+
+func sampleTraceID(traceID []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(traceID)
+	return h.Sum32()
+}
@@ -0,0 +1,105 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// TestProbabilisticSamplerTracesProcessorKeepsSurvivingSpans verifies that
+// dropping an interior span doesn't corrupt the spans that follow it: every
+// kept span must retain its own identity, not a copy of the dropped span.
+func TestProbabilisticSamplerTracesProcessorKeepsSurvivingSpans(t *testing.T) {
+	traces := pdata.NewTraces()
+	ilss := traces.ResourceSpans().AppendEmpty().InstrumentationLibrarySpans().AppendEmpty()
+	spans := ilss.Spans()
+
+	ids := [][]byte{
+		{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2},
+		{3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3},
+		{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4},
+	}
+	for i, id := range ids {
+		span := spans.AppendEmpty()
+		var traceID [16]byte
+		copy(traceID[:], id)
+		span.SetTraceID(pdata.NewTraceID(traceID))
+		span.SetName(spanName(i))
+	}
+
+	// Pick the sampling percentage so that exactly the third span (index 2),
+	// whose trace ID hashes highest, falls above threshold, by keeping
+	// everything at or below one less than its hash.
+	dropThreshold := sampleTraceID(ids[2]) - 1
+	percentage := float64(dropThreshold) / float64(^uint32(0)) * 100
+	if percentage <= 0 {
+		percentage = 1
+	}
+
+	dropped := monitoring.NewInt(monitoring.Default.NewRegistry("_test_sampler"), "dropped")
+	var gotTraces pdata.Traces
+	next := tracesProcessorFunc(func(_ context.Context, traces pdata.Traces) error {
+		gotTraces = traces
+		return nil
+	})
+
+	processor, err := newProbabilisticSamplerTracesProcessor(
+		ProbabilisticSamplerConfig{SamplingPercentage: percentage}, dropped, next,
+	)
+	require.NoError(t, err)
+	require.NoError(t, processor.ConsumeTraces(context.Background(), traces))
+
+	outSpans := gotTraces.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans()
+	var names []string
+	for i := 0; i < outSpans.Len(); i++ {
+		names = append(names, outSpans.At(i).Name())
+	}
+	assert.NotContains(t, names, spanName(2), "dropped span must not survive sampling")
+	for i, id := range ids {
+		if sampleTraceID(id) <= dropThreshold {
+			assert.Contains(t, names, spanName(i), "kept span must retain its own identity")
+		}
+	}
+}
+
+func spanName(i int) string {
+	return string(rune('a' + i))
+}
+
+// TestNewProbabilisticSamplerTracesProcessorRejectsInvalidPercentage verifies
+// that an unset or out-of-range sampling_percentage is rejected at chain-build
+// time rather than silently sampling at or near 0%.
+func TestNewProbabilisticSamplerTracesProcessorRejectsInvalidPercentage(t *testing.T) {
+	dropped := monitoring.NewInt(monitoring.Default.NewRegistry("_test_sampler_invalid"), "dropped")
+	next := tracesProcessorFunc(func(context.Context, pdata.Traces) error { return nil })
+
+	for _, percentage := range []float64{0, -1, 100.1, 500} {
+		_, err := newProbabilisticSamplerTracesProcessor(
+			ProbabilisticSamplerConfig{SamplingPercentage: percentage}, dropped, next,
+		)
+		assert.Errorf(t, err, "expected an error for sampling_percentage=%v", percentage)
+	}
+}
@@ -0,0 +1,72 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import "sync"
+
+// consumerSet tracks the monitoredConsumers backing the OTLP listeners of a
+// single transport (gRPC or HTTP), keyed by endpoint. Each endpoint is
+// registered once, at listener startup; monitoring.Registry has no way to
+// unregister a sub-registry, so RegisterGRPCServices/RegisterHTTPHandlers
+// reject a second registration for the same endpoint rather than re-creating
+// one (which would panic on the duplicate name). remove exists for rolling
+// back a registration that failed partway through, after add but before the
+// listener is fully up.
+type consumerSet struct {
+	mu        sync.RWMutex
+	consumers map[string]*monitoredConsumer
+}
+
+func newConsumerSet() *consumerSet {
+	return &consumerSet{consumers: make(map[string]*monitoredConsumer)}
+}
+
+// has reports whether a consumer is already registered for endpoint.
+func (s *consumerSet) has(endpoint string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.consumers[endpoint]
+	return ok
+}
+
+// add registers c under endpoint. Callers must check has(endpoint) first;
+// add does not itself guard against overwriting an existing registration.
+func (s *consumerSet) add(endpoint string, c *monitoredConsumer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consumers[endpoint] = c
+}
+
+// remove unregisters the consumer for endpoint, if any.
+func (s *consumerSet) remove(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.consumers, endpoint)
+}
+
+// snapshot returns a point-in-time copy of the registered consumers, safe for
+// the caller to range over without holding the set's lock.
+func (s *consumerSet) snapshot() map[string]*monitoredConsumer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]*monitoredConsumer, len(s.consumers))
+	for endpoint, c := range s.consumers {
+		out[endpoint] = c
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package request holds shared conventions for reporting per-endpoint
+// request/response monitoring counters across apm-server's listeners.
+package request
+
+import "github.com/elastic/beats/v7/libbeat/monitoring"
+
+// ResultID identifies one of the monitoring counters tracked for a listener's
+// requests and responses.
+type ResultID string
+
+// Counter names reported under each listener's monitoring registry. These are
+// shared across transports (e.g. OTLP/gRPC and OTLP/HTTP) so operators see
+// the same set of counters regardless of which protocol a listener speaks.
+const (
+	IDRequestCount          ResultID = "request.count"
+	IDResponseCount         ResultID = "response.count"
+	IDResponseErrorsCount   ResultID = "response.errors.count"
+	IDResponseValidCount    ResultID = "response.valid.count"
+	IDResponsePartialCount  ResultID = "response.valid.partial.count"
+	IDResponseRejectedCount ResultID = "response.valid.partial.rejected.count"
+)
+
+// MonitoringMapForRegistry creates a monitoring.Int counter under reg for
+// each of keys, named after the ResultID, and returns them keyed by ResultID
+// for cheap lookup on the request path.
+func MonitoringMapForRegistry(reg *monitoring.Registry, keys []ResultID) map[ResultID]*monitoring.Int {
+	m := make(map[ResultID]*monitoring.Int, len(keys))
+	for _, key := range keys {
+		m[key] = monitoring.NewInt(reg, string(key))
+	}
+	return m
+}
@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/apm-server/model"
+)
+
+// ConsumeResult reports the outcome of handing a converted batch of events
+// to Processor. Rejected counts events that weren't ingested, and
+// ErrorMessage carries a summary of why, so beater/otlp can build an OTLP
+// partial-success response instead of failing the whole request outright.
+type ConsumeResult struct {
+	Rejected     int
+	ErrorMessage string
+}
+
+// Stats holds running counters describing the data a Consumer has processed.
+type Stats struct {
+	// UnsupportedMetricsDropped counts metrics dropped by ConvertMetrics
+	// because their data type isn't supported or they have no data points.
+	UnsupportedMetricsDropped int64
+}
+
+// Consumer converts OTLP traces, metrics and logs into model.APMEvents and
+// hands them to Processor for ingestion.
+type Consumer struct {
+	Processor model.BatchProcessor
+
+	unsupportedMetricsDropped int64
+}
+
+// Stats returns a snapshot of the counters accumulated so far.
+func (c *Consumer) Stats() Stats {
+	return Stats{UnsupportedMetricsDropped: atomic.LoadInt64(&c.unsupportedMetricsDropped)}
+}
+
+// ConsumeTraces converts and ingests OTLP trace data. It returns a
+// ConsumeResult alongside the error, so it does not itself satisfy
+// consumer.Traces.
+func (c *Consumer) ConsumeTraces(ctx context.Context, traces pdata.Traces) (ConsumeResult, error) {
+	return c.consume(ctx, ConvertTraces(traces))
+}
+
+// ConsumeMetrics converts and ingests OTLP metrics data, returning a
+// ConsumeResult alongside the error as ConsumeTraces does.
+func (c *Consumer) ConsumeMetrics(ctx context.Context, metrics pdata.Metrics) (ConsumeResult, error) {
+	events, unsupportedDropped := ConvertMetrics(metrics)
+	atomic.AddInt64(&c.unsupportedMetricsDropped, unsupportedDropped)
+	return c.consume(ctx, events)
+}
+
+// ConsumeLogs converts and ingests OTLP log records, returning a
+// ConsumeResult alongside the error as ConsumeTraces does.
+func (c *Consumer) ConsumeLogs(ctx context.Context, logs pdata.Logs) (ConsumeResult, error) {
+	return c.consume(ctx, ConvertLogs(logs))
+}
+
+// consume hands events to Processor. apm-server's BatchProcessor is
+// all-or-nothing, so a failure here rejects every event in the batch rather
+// than a partial subset.
+func (c *Consumer) consume(ctx context.Context, events []model.APMEvent) (ConsumeResult, error) {
+	if len(events) == 0 {
+		return ConsumeResult{}, nil
+	}
+	batch := make(model.Batch, len(events))
+	copy(batch, events)
+	if err := c.Processor.ProcessBatch(ctx, &batch); err != nil {
+		return ConsumeResult{Rejected: len(events), ErrorMessage: err.Error()}, err
+	}
+	return ConsumeResult{}, nil
+}
@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/apm-server/model"
+)
+
+// fakeBatchProcessor records the batches it's given and returns err, the way
+// a real model.BatchProcessor would fail if ingestion is rejected downstream.
+type fakeBatchProcessor struct {
+	err     error
+	batches []model.Batch
+}
+
+func (f *fakeBatchProcessor) ProcessBatch(_ context.Context, batch *model.Batch) error {
+	f.batches = append(f.batches, *batch)
+	return f.err
+}
+
+func TestConsumerConsumeLogsSuccess(t *testing.T) {
+	processor := &fakeBatchProcessor{}
+	c := &Consumer{Processor: processor}
+
+	logs := pdata.NewLogs()
+	record := logs.ResourceLogs().AppendEmpty().InstrumentationLibraryLogs().AppendEmpty().Logs().AppendEmpty()
+	record.Body().SetStringVal("hello")
+
+	result, err := c.ConsumeLogs(context.Background(), logs)
+	require.NoError(t, err)
+	assert.Equal(t, ConsumeResult{}, result)
+	require.Len(t, processor.batches, 1)
+	assert.Len(t, processor.batches[0], 1)
+}
+
+func TestConsumerConsumeLogsProcessorError(t *testing.T) {
+	processor := &fakeBatchProcessor{err: errors.New("ingest failed")}
+	c := &Consumer{Processor: processor}
+
+	logs := pdata.NewLogs()
+	logs.ResourceLogs().AppendEmpty().InstrumentationLibraryLogs().AppendEmpty().Logs().AppendEmpty()
+
+	result, err := c.ConsumeLogs(context.Background(), logs)
+	assert.Error(t, err)
+	assert.Equal(t, 1, result.Rejected)
+	assert.Equal(t, "ingest failed", result.ErrorMessage)
+}
+
+func TestConsumerConsumeMetricsTracksUnsupportedDropped(t *testing.T) {
+	processor := &fakeBatchProcessor{}
+	c := &Consumer{Processor: processor}
+
+	metrics := pdata.NewMetrics()
+	metric := metrics.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("latency")
+	metric.SetDataType(pdata.MetricDataTypeHistogram)
+
+	_, err := c.ConsumeMetrics(context.Background(), metrics)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), c.Stats().UnsupportedMetricsDropped)
+}
+
+func TestConsumerConsumeTracesEmptyIsNoop(t *testing.T) {
+	processor := &fakeBatchProcessor{}
+	c := &Consumer{Processor: processor}
+
+	result, err := c.ConsumeTraces(context.Background(), pdata.NewTraces())
+	require.NoError(t, err)
+	assert.Equal(t, ConsumeResult{}, result)
+	assert.Empty(t, processor.batches)
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/apm-server/model"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// ConvertLogs maps an OTLP pdata.Logs payload into APM Server's internal log
+// event model, one model.APMEvent per pdata.LogRecord. Consumer.ConsumeLogs
+// calls this before handing events to Processor, the same way ConvertTraces
+// and ConvertMetrics feed ConsumeTraces/ConsumeMetrics.
+func ConvertLogs(logs pdata.Logs) []model.APMEvent {
+	var events []model.APMEvent
+	resourceLogs := logs.ResourceLogs()
+	for i := 0; i < resourceLogs.Len(); i++ {
+		rl := resourceLogs.At(i)
+		resourceAttrs := rl.Resource().Attributes()
+		ills := rl.InstrumentationLibraryLogs()
+		for j := 0; j < ills.Len(); j++ {
+			records := ills.At(j).Logs()
+			for k := 0; k < records.Len(); k++ {
+				events = append(events, convertLogRecord(records.At(k), resourceAttrs))
+			}
+		}
+	}
+	return events
+}
+
+// convertLogRecord maps a single OTLP log record, together with its
+// resource's attributes, into a model.APMEvent carrying a log document.
+// Records that carry a trace/span ID get their Trace/Transaction fields
+// populated so the log can be correlated with the originating trace in
+// Elasticsearch.
+func convertLogRecord(record pdata.LogRecord, resourceAttrs pdata.AttributeMap) model.APMEvent {
+	event := model.APMEvent{
+		Timestamp: record.Timestamp().AsTime(),
+		Processor: model.Processor{Name: "log", Event: "log"},
+		Labels:    attributesToLabels(resourceAttrs, record.Attributes()),
+		Message:   record.Body().StringVal(),
+		Log: model.Log{
+			Level: record.SeverityText(),
+		},
+	}
+	if traceID := record.TraceID(); !traceID.IsEmpty() {
+		event.Trace.ID = traceID.HexString()
+	}
+	if spanID := record.SpanID(); !spanID.IsEmpty() {
+		event.Transaction = &model.Transaction{ID: spanID.HexString()}
+	}
+	return event
+}
+
+// attributesToLabels flattens resource and record attributes into a single
+// set of labels, with record attributes taking precedence over a resource
+// attribute of the same key.
+func attributesToLabels(resourceAttrs, recordAttrs pdata.AttributeMap) common.MapStr {
+	labels := make(common.MapStr)
+	resourceAttrs.Range(func(k string, v pdata.AttributeValue) bool {
+		labels[k] = v.AsString()
+		return true
+	})
+	recordAttrs.Range(func(k string, v pdata.AttributeValue) bool {
+		labels[k] = v.AsString()
+		return true
+	})
+	return labels
+}
@@ -0,0 +1,60 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/pdata"
+)
+
+func TestConvertLogs(t *testing.T) {
+	logs := pdata.NewLogs()
+	rl := logs.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().InsertString("service.name", "checkoutservice")
+
+	record := rl.InstrumentationLibraryLogs().AppendEmpty().Logs().AppendEmpty()
+	record.Body().SetStringVal("payment declined")
+	record.SetSeverityText("ERROR")
+	record.Attributes().InsertString("http.method", "POST")
+
+	var traceID [16]byte
+	traceID[0] = 1
+	record.SetTraceID(pdata.NewTraceID(traceID))
+	var spanID [8]byte
+	spanID[0] = 2
+	record.SetSpanID(pdata.NewSpanID(spanID))
+
+	events := ConvertLogs(logs)
+	require.Len(t, events, 1)
+
+	event := events[0]
+	assert.Equal(t, "payment declined", event.Message)
+	assert.Equal(t, "ERROR", event.Log.Level)
+	assert.Equal(t, "checkoutservice", event.Labels["service.name"])
+	assert.Equal(t, "POST", event.Labels["http.method"])
+	assert.Equal(t, pdata.NewTraceID(traceID).HexString(), event.Trace.ID)
+	require.NotNil(t, event.Transaction)
+	assert.Equal(t, pdata.NewSpanID(spanID).HexString(), event.Transaction.ID)
+}
+
+func TestConvertLogsNoRecords(t *testing.T) {
+	assert.Empty(t, ConvertLogs(pdata.NewLogs()))
+}
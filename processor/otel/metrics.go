@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/apm-server/model"
+)
+
+// ConvertMetrics maps an OTLP pdata.Metrics payload into APM Server's
+// internal event model, one model.APMEvent per instrumentation library
+// carrying one metricset sample per metric name, valued from that metric's
+// last data point. It also returns the number of metrics dropped because
+// their type isn't supported (e.g. histograms, summaries) or they have no
+// data points, for callers to report via Consumer.Stats.
+func ConvertMetrics(metrics pdata.Metrics) ([]model.APMEvent, int64) {
+	var events []model.APMEvent
+	var unsupportedDropped int64
+	rms := metrics.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		resourceAttrs := rm.Resource().Attributes()
+		ilms := rm.InstrumentationLibraryMetrics()
+		for j := 0; j < ilms.Len(); j++ {
+			ms := ilms.At(j).Metrics()
+			samples := make(map[string]model.MetricsetSample)
+			for k := 0; k < ms.Len(); k++ {
+				metric := ms.At(k)
+				value, ok := convertMetricValue(metric)
+				if !ok {
+					unsupportedDropped++
+					continue
+				}
+				samples[metric.Name()] = model.MetricsetSample{Value: value}
+			}
+			if len(samples) == 0 {
+				continue
+			}
+			events = append(events, model.APMEvent{
+				Processor: model.Processor{Name: "metric", Event: "metric"},
+				Labels:    attributesToLabels(resourceAttrs, pdata.NewAttributeMap()),
+				Metricset: &model.Metricset{Samples: samples},
+			})
+		}
+	}
+	return events, unsupportedDropped
+}
+
+// convertMetricValue returns the last data point's value for the metric
+// types apm-server understands (gauge and sum), and ok=false for a gauge or
+// sum with no data points and for types with no single-value representation
+// (e.g. histogram, summary).
+func convertMetricValue(metric pdata.Metric) (float64, bool) {
+	switch metric.DataType() {
+	case pdata.MetricDataTypeGauge:
+		dps := metric.Gauge().DataPoints()
+		if dps.Len() == 0 {
+			return 0, false
+		}
+		return dps.At(dps.Len() - 1).DoubleVal(), true
+	case pdata.MetricDataTypeSum:
+		dps := metric.Sum().DataPoints()
+		if dps.Len() == 0 {
+			return 0, false
+		}
+		return dps.At(dps.Len() - 1).DoubleVal(), true
+	default:
+		return 0, false
+	}
+}
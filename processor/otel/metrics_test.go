@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/pdata"
+)
+
+func TestConvertMetricsGauge(t *testing.T) {
+	metrics := pdata.NewMetrics()
+	ilm := metrics.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty()
+	metric := ilm.Metrics().AppendEmpty()
+	metric.SetName("queue.size")
+	metric.SetDataType(pdata.MetricDataTypeGauge)
+	metric.Gauge().DataPoints().AppendEmpty().SetDoubleVal(42)
+
+	events, unsupportedDropped := ConvertMetrics(metrics)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(0), unsupportedDropped)
+	sample, ok := events[0].Metricset.Samples["queue.size"]
+	require.True(t, ok)
+	assert.Equal(t, 42.0, sample.Value)
+}
+
+func TestConvertMetricsUnsupportedTypeDropped(t *testing.T) {
+	metrics := pdata.NewMetrics()
+	ilm := metrics.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty()
+	metric := ilm.Metrics().AppendEmpty()
+	metric.SetName("latency")
+	metric.SetDataType(pdata.MetricDataTypeHistogram)
+
+	events, unsupportedDropped := ConvertMetrics(metrics)
+	assert.Empty(t, events)
+	assert.Equal(t, int64(1), unsupportedDropped)
+}
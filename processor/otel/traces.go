@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"go.opentelemetry.io/collector/consumer/pdata"
+
+	"github.com/elastic/apm-server/model"
+)
+
+// ConvertTraces maps an OTLP pdata.Traces payload into APM Server's internal
+// event model, one model.APMEvent per span. A span with no parent becomes a
+// model.Transaction event; all others become model.Span events.
+func ConvertTraces(traces pdata.Traces) []model.APMEvent {
+	var events []model.APMEvent
+	rss := traces.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		resourceAttrs := rs.Resource().Attributes()
+		ilss := rs.InstrumentationLibrarySpans()
+		for j := 0; j < ilss.Len(); j++ {
+			spans := ilss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				events = append(events, convertSpan(spans.At(k), resourceAttrs))
+			}
+		}
+	}
+	return events
+}
+
+// convertSpan maps a single OTLP span, together with its resource's
+// attributes, into a model.APMEvent.
+func convertSpan(span pdata.Span, resourceAttrs pdata.AttributeMap) model.APMEvent {
+	event := model.APMEvent{
+		Timestamp: span.StartTimestamp().AsTime(),
+		Labels:    attributesToLabels(resourceAttrs, span.Attributes()),
+	}
+	event.Trace.ID = span.TraceID().HexString()
+	duration := span.EndTimestamp().AsTime().Sub(span.StartTimestamp().AsTime())
+	if span.ParentSpanID().IsEmpty() {
+		event.Processor = model.Processor{Name: "transaction", Event: "transaction"}
+		event.Transaction = &model.Transaction{
+			ID:       span.SpanID().HexString(),
+			Name:     span.Name(),
+			Duration: duration.Seconds() * 1000,
+		}
+	} else {
+		event.Processor = model.Processor{Name: "span", Event: "span"}
+		event.Span = &model.Span{
+			ID:       span.SpanID().HexString(),
+			Name:     span.Name(),
+			Duration: duration.Seconds() * 1000,
+		}
+	}
+	return event
+}
@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/pdata"
+)
+
+func TestConvertTracesRootSpanIsTransaction(t *testing.T) {
+	traces := pdata.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("GET /orders")
+	var traceID [16]byte
+	traceID[0] = 1
+	span.SetTraceID(pdata.NewTraceID(traceID))
+	var spanID [8]byte
+	spanID[0] = 2
+	span.SetSpanID(pdata.NewSpanID(spanID))
+
+	events := ConvertTraces(traces)
+	require.Len(t, events, 1)
+	event := events[0]
+	require.NotNil(t, event.Transaction)
+	assert.Nil(t, event.Span)
+	assert.Equal(t, "GET /orders", event.Transaction.Name)
+	assert.Equal(t, pdata.NewTraceID(traceID).HexString(), event.Trace.ID)
+}
+
+func TestConvertTracesChildSpanIsSpan(t *testing.T) {
+	traces := pdata.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("SELECT orders")
+	var parentSpanID [8]byte
+	parentSpanID[0] = 9
+	span.SetParentSpanID(pdata.NewSpanID(parentSpanID))
+
+	events := ConvertTraces(traces)
+	require.Len(t, events, 1)
+	event := events[0]
+	require.NotNil(t, event.Span)
+	assert.Nil(t, event.Transaction)
+	assert.Equal(t, "SELECT orders", event.Span.Name)
+}